@@ -1,6 +1,7 @@
 package actions
 
 import (
+	"log"
 	"net/http"
 
 	"github.com/gobuffalo/buffalo"
@@ -15,9 +16,14 @@ import (
 // application is being run. Default is "development".
 var ENV = envy.Get("GO_ENV", "development")
 
-// STORE should be pointed at the password-store
+// STORE should be pointed at the password-store. It is used as a
+// single-store shortcut for STORES when STORES is unset.
 var STORE = envy.Get("PASSWORD_STORE", ".")
 
+// STORES configures one or more named password-stores to serve. See
+// parseStores for its format.
+var STORES = envy.Get("STORES", "")
+
 var app *buffalo.App
 
 // App is where all routes and middleware for buffalo
@@ -46,11 +52,31 @@ func App() *buffalo.App {
 			app.Use(middleware.ParameterLogger)
 		}
 
+		// Require a bearer token on every secrets route so the server can
+		// be safely exposed without relying on network-level ACLs.
+		app.Use(requireToken(parseTokens(TOKENS)))
+
+		stores, err := parseStores(STORES)
+		if err != nil {
+			log.Fatalf("invalid STORES: %v", err)
+		}
+		if len(stores) == 0 {
+			stores = []Store{{Name: defaultStoreName, Path: STORE}}
+		}
+
 		secretsResource := &SecretsResource{
-			store: STORE,
+			stores: stores,
+		}
+		if err := secretsResource.Watch(); err != nil {
+			log.Printf("unable to start password store watcher, falling back to load-on-request: %v", err)
 		}
 		app.POST("/secret", secretsResource.Show)
 		app.POST("/secrets", secretsResource.List)
+		app.POST("/secret/new", secretsResource.Create)
+		app.POST("/secret/edit", secretsResource.Update)
+		app.POST("/secret/delete", secretsResource.Delete)
+		app.POST("/reload", secretsResource.Reload)
+		app.GET("/secrets/stream", secretsResource.Stream)
 	}
 
 	return app
@@ -0,0 +1,149 @@
+package actions
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/gobuffalo/buffalo"
+	"github.com/gobuffalo/envy"
+)
+
+// TOKENS authorizes requests to the secrets endpoints. It is a
+// semicolon-separated list of "token=store1:prefix1,store2:prefix2" entries
+// mapping a bearer token to the store+path prefixes it may access, e.g.
+//
+//	TOKENS="abc123=work:project/,personal:personal/;def456=personal:"
+//
+// A prefix with nothing after the ":" (or no ":" at all) authorizes the
+// whole named store. A token with no prefixes after the "=" is authorized
+// for every store and path.
+var TOKENS = envy.Get("TOKENS", "")
+
+const allowedPrefixesKey = "allowedPrefixes"
+
+// tokenScope is a single store+path-prefix a token is authorized for.
+type tokenScope struct {
+	Store  string
+	Prefix string
+}
+
+// parseTokens parses the TOKENS env var into a token -> allowed scopes
+// lookup.
+func parseTokens(s string) map[string][]tokenScope {
+	tokens := make(map[string][]tokenScope)
+	if s == "" {
+		return tokens
+	}
+	for _, entry := range strings.Split(s, ";") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		parts := strings.SplitN(entry, "=", 2)
+		token := strings.TrimSpace(parts[0])
+		if token == "" {
+			continue
+		}
+		var scopes []tokenScope
+		if len(parts) == 2 {
+			for _, raw := range strings.Split(parts[1], ",") {
+				raw = strings.TrimSpace(raw)
+				if raw == "" {
+					continue
+				}
+				store, prefix := raw, ""
+				if i := strings.Index(raw, ":"); i >= 0 {
+					store, prefix = raw[:i], raw[i+1:]
+				}
+				scopes = append(scopes, tokenScope{Store: store, Prefix: prefix})
+			}
+		}
+		tokens[token] = scopes
+	}
+	return tokens
+}
+
+// requireToken returns middleware that rejects requests which do not carry a
+// bearer token present in tokens. The token is read from the Authorization
+// header ("Bearer <token>") or, failing that, the "token" query parameter.
+// Handlers can retrieve the matched token's allowed scopes via
+// allowedPrefixes(c).
+func requireToken(tokens map[string][]tokenScope) buffalo.MiddlewareFunc {
+	return func(next buffalo.Handler) buffalo.Handler {
+		return func(c buffalo.Context) error {
+			token := bearerToken(c.Request())
+			scopes, ok := tokens[token]
+			if token == "" || !ok {
+				var response struct {
+					Error string `json:"error"`
+				}
+				response.Error = "missing or unrecognized bearer token"
+				return c.Render(http.StatusForbidden, r.JSON(response))
+			}
+			c.Set(allowedPrefixesKey, scopes)
+			return next(c)
+		}
+	}
+}
+
+func bearerToken(req *http.Request) string {
+	const prefix = "Bearer "
+	if auth := req.Header.Get("Authorization"); strings.HasPrefix(auth, prefix) {
+		return strings.TrimPrefix(auth, prefix)
+	}
+	return req.URL.Query().Get("token")
+}
+
+// allowedPrefixes returns the store+path scopes the request's bearer token
+// is authorized for. A nil/empty slice means the token is authorized for
+// every store and path.
+func allowedPrefixes(c buffalo.Context) []tokenScope {
+	scopes, _ := c.Value(allowedPrefixesKey).([]tokenScope)
+	return scopes
+}
+
+// filterIndexByScope returns the subset of index (store name -> armored
+// index) that scopes authorizes. An empty scopes means unrestricted access,
+// so index is returned unchanged. Since the index is one opaque encrypted
+// blob per store, only a scope with an empty/whole-store prefix can
+// meaningfully authorize it; a store the token can only see part of is
+// omitted entirely.
+func filterIndexByScope(scopes []tokenScope, index map[string]string) map[string]string {
+	if len(scopes) == 0 {
+		return index
+	}
+	allowed := make(map[string]bool)
+	for _, scope := range scopes {
+		if strings.TrimSuffix(scope.Prefix, "/") == "" {
+			allowed[scope.Store] = true
+		}
+	}
+	filtered := make(map[string]string, len(allowed))
+	for name, armored := range index {
+		if allowed[name] {
+			filtered[name] = armored
+		}
+	}
+	return filtered
+}
+
+// authorized reports whether path in store is covered by one of scopes. An
+// empty scopes means unrestricted access. Matching is on path segments, so
+// prefix "per" does not match path "personal/gmail"; "personal" and
+// "personal/" both do. A scope with an empty prefix authorizes every path
+// in its store.
+func authorized(scopes []tokenScope, store, path string) bool {
+	if len(scopes) == 0 {
+		return true
+	}
+	for _, scope := range scopes {
+		if scope.Store != store {
+			continue
+		}
+		prefix := strings.TrimSuffix(scope.Prefix, "/")
+		if prefix == "" || path == prefix || strings.HasPrefix(path, prefix+"/") {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,56 @@
+package actions
+
+import "testing"
+
+func TestAuthorized(t *testing.T) {
+	tests := []struct {
+		name   string
+		scopes []tokenScope
+		store  string
+		path   string
+		want   bool
+	}{
+		{"no scopes means unrestricted", nil, "personal", "anything", true},
+		{"exact path match", []tokenScope{{Store: "personal", Prefix: "personal/gmail"}}, "personal", "personal/gmail", true},
+		{"path under prefix", []tokenScope{{Store: "work", Prefix: "work/"}}, "work", "work/project", true},
+		{"prefix without trailing slash still matches segment", []tokenScope{{Store: "work", Prefix: "work"}}, "work", "work/project", true},
+		{"bare prefix does not match unrelated sibling segment", []tokenScope{{Store: "personal", Prefix: "per"}}, "personal", "personal/gmail", false},
+		{"empty prefix authorizes whole store", []tokenScope{{Store: "work", Prefix: ""}}, "work", "work/anything", true},
+		{"wrong store is never authorized", []tokenScope{{Store: "personal", Prefix: ""}}, "work", "work/anything", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := authorized(tt.scopes, tt.store, tt.path); got != tt.want {
+				t.Errorf("authorized(%v, %q, %q) = %v, want %v", tt.scopes, tt.store, tt.path, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseTokens(t *testing.T) {
+	tokens := parseTokens("abc123=work:project/,personal:personal/;def456=personal:;unrestricted=")
+	if got, want := tokens["abc123"], []tokenScope{{Store: "work", Prefix: "project/"}, {Store: "personal", Prefix: "personal/"}}; !scopesEqual(got, want) {
+		t.Errorf("abc123 scopes = %v, want %v", got, want)
+	}
+	if got, want := tokens["def456"], []tokenScope{{Store: "personal", Prefix: ""}}; !scopesEqual(got, want) {
+		t.Errorf("def456 scopes = %v, want %v", got, want)
+	}
+	if scopes, ok := tokens["unrestricted"]; !ok || len(scopes) != 0 {
+		t.Errorf("unrestricted scopes = %v, ok %v, want empty and present", scopes, ok)
+	}
+	if _, ok := tokens["missing"]; ok {
+		t.Errorf("unexpected token found for %q", "missing")
+	}
+}
+
+func scopesEqual(a, b []tokenScope) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,199 @@
+package actions
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/gobuffalo/envy"
+	"github.com/pkg/errors"
+	"golang.org/x/crypto/openpgp"
+	"golang.org/x/crypto/openpgp/armor"
+	"golang.org/x/crypto/openpgp/packet"
+)
+
+// PUBLIC_KEYRING overrides the default "<store>/.public-keys" location used
+// to look up recipient public keys for in-process index encryption.
+var PUBLIC_KEYRING = envy.Get("PUBLIC_KEYRING", "")
+
+// encryptIndex encrypts plaintext to the recipients named in ids, preferring
+// keys loaded from the store's public keyring so no gpg subprocess is
+// needed. It falls back to shelling out to gpg when a recipient's key is
+// missing from the keyring.
+func encryptIndex(store Store, ids []string, plaintext []byte) (string, error) {
+	keyring, err := loadKeyring(keyringPath(store))
+	if err != nil {
+		return "", errors.Wrap(err, "unable to load public keyring")
+	}
+	entities, missing := entitiesForIDs(keyring, ids)
+	if len(ids) > 0 && len(missing) == 0 {
+		return encryptInProcess(entities, plaintext)
+	}
+	if len(missing) > 0 {
+		log.Printf("store %q: key(s) not found in keyring, falling back to gpg: %s", store.Name, strings.Join(missing, ", "))
+	}
+	return encryptWithGPG(ids, plaintext)
+}
+
+// keyringPath returns the public keyring location for store: PUBLIC_KEYRING
+// if set, otherwise "<store>/.public-keys".
+func keyringPath(store Store) string {
+	if PUBLIC_KEYRING != "" {
+		return PUBLIC_KEYRING
+	}
+	return filepath.Join(store.Path, ".public-keys")
+}
+
+// loadKeyring reads every public key found at path, which may be a single
+// keyring file or a directory containing one key per file. A missing path
+// yields an empty keyring rather than an error, since a store need not have
+// a local keyring configured.
+func loadKeyring(path string) (openpgp.EntityList, error) {
+	info, err := os.Stat(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	filenames := []string{path}
+	if info.IsDir() {
+		entries, err := ioutil.ReadDir(path)
+		if err != nil {
+			return nil, err
+		}
+		filenames = filenames[:0]
+		for _, entry := range entries {
+			if !entry.IsDir() {
+				filenames = append(filenames, filepath.Join(path, entry.Name()))
+			}
+		}
+	}
+	var keyring openpgp.EntityList
+	for _, filename := range filenames {
+		entities, err := readKeyFile(filename)
+		if err != nil {
+			return nil, errors.Wrapf(err, "unable to parse public key file %s", filename)
+		}
+		keyring = append(keyring, entities...)
+	}
+	return keyring, nil
+}
+
+// readKeyFile parses filename as an armored keyring, falling back to binary
+// (non-armored) keyring format.
+func readKeyFile(filename string) (openpgp.EntityList, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	if entities, err := openpgp.ReadArmoredKeyRing(f); err == nil {
+		return entities, nil
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+	return openpgp.ReadKeyRing(f)
+}
+
+// entitiesForIDs resolves each recipient id (a gpg key ID or fingerprint) to
+// an entity in keyring, reporting any ids that could not be found.
+func entitiesForIDs(keyring openpgp.EntityList, ids []string) (entities openpgp.EntityList, missing []string) {
+	for _, id := range ids {
+		entity := findEntity(keyring, id)
+		if entity == nil {
+			missing = append(missing, id)
+			continue
+		}
+		entities = append(entities, entity)
+	}
+	return entities, missing
+}
+
+func findEntity(keyring openpgp.EntityList, id string) *openpgp.Entity {
+	for _, entity := range keyring {
+		if keyMatches(entity.PrimaryKey, id) {
+			return entity
+		}
+		for _, subkey := range entity.Subkeys {
+			if keyMatches(subkey.PublicKey, id) {
+				return entity
+			}
+		}
+	}
+	return nil
+}
+
+// isHexKeyID reports whether id is a gpg short ID (8 hex chars) or long ID
+// (16 hex chars), the only lengths gpg itself accepts for suffix matching a
+// fingerprint.
+func isHexKeyID(id string) bool {
+	if len(id) != 8 && len(id) != 16 {
+		return false
+	}
+	for _, r := range id {
+		if !strings.ContainsRune("0123456789ABCDEF", r) {
+			return false
+		}
+	}
+	return true
+}
+
+func keyMatches(key *packet.PublicKey, id string) bool {
+	id = strings.ToUpper(strings.TrimPrefix(id, "0x"))
+	fingerprint := strings.ToUpper(fmt.Sprintf("%X", key.Fingerprint))
+	keyID := strings.ToUpper(fmt.Sprintf("%016X", key.KeyId))
+	if fingerprint == id || keyID == id {
+		return true
+	}
+	return isHexKeyID(id) && strings.HasSuffix(fingerprint, id)
+}
+
+// encryptInProcess PGP-encrypts and armors plaintext for entities without
+// shelling out to gpg.
+func encryptInProcess(entities openpgp.EntityList, plaintext []byte) (string, error) {
+	buf := &bytes.Buffer{}
+	armorWriter, err := armor.Encode(buf, "PGP MESSAGE", nil)
+	if err != nil {
+		return "", errors.Wrap(err, "failed to create armor encoder")
+	}
+	plaintextWriter, err := openpgp.Encrypt(armorWriter, entities, nil, nil, nil)
+	if err != nil {
+		return "", errors.Wrap(err, "failed to create openpgp encryptor")
+	}
+	if _, err := plaintextWriter.Write(plaintext); err != nil {
+		return "", errors.Wrap(err, "failed to write plaintext to encryptor")
+	}
+	if err := plaintextWriter.Close(); err != nil {
+		return "", errors.Wrap(err, "failed to close openpgp encryptor")
+	}
+	if err := armorWriter.Close(); err != nil {
+		return "", errors.Wrap(err, "failed to close armor encoder")
+	}
+	return buf.String(), nil
+}
+
+// encryptWithGPG shells out to "gpg --encrypt --armor" for each id, as Load
+// always used to. It remains the fallback for recipients whose key is not
+// present in a local keyring.
+func encryptWithGPG(ids []string, plaintext []byte) (string, error) {
+	args := []string{"--encrypt", "--armor"}
+	for _, id := range ids {
+		args = append(args, "-r", id)
+	}
+	buf := &bytes.Buffer{}
+	cmd := exec.Command("gpg", args...)
+	cmd.Stdin = bytes.NewReader(plaintext)
+	cmd.Stdout = buf
+	if err := cmd.Run(); err != nil {
+		return "", errors.Wrap(err, "unable to run gpg command to encrypt index")
+	}
+	return buf.String(), nil
+}
@@ -0,0 +1,41 @@
+package actions
+
+import (
+	"testing"
+
+	"golang.org/x/crypto/openpgp/packet"
+)
+
+func testPublicKey() *packet.PublicKey {
+	key := &packet.PublicKey{KeyId: 0x99AABBCC11223344}
+	key.Fingerprint = [20]byte{
+		0xAB, 0xCD, 0xEF, 0x12, 0x34, 0x56, 0x78, 0x90,
+		0x11, 0x22, 0x33, 0x44, 0x55, 0x66, 0x77, 0x88,
+		0x99, 0xAA, 0xBB, 0xCC,
+	}
+	return key
+}
+
+func TestKeyMatches(t *testing.T) {
+	key := testPublicKey()
+	tests := []struct {
+		name string
+		id   string
+		want bool
+	}{
+		{"full fingerprint", "ABCDEF1234567890112233445566778899AABBCC", true},
+		{"0x-prefixed fingerprint, case-insensitive", "0xabcdef1234567890112233445566778899aabbcc", true},
+		{"16-char long ID suffix of fingerprint", "5566778899AABBCC", true},
+		{"8-char short ID suffix of fingerprint", "99AABBCC", true},
+		{"key ID field match", "99AABBCC11223344", true},
+		{"non-canonical-length fingerprint fragment is rejected", "778899AABBCC", false},
+		{"unrelated id", "0000000000000000", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := keyMatches(key, tt.id); got != tt.want {
+				t.Errorf("keyMatches(key, %q) = %v, want %v", tt.id, got, tt.want)
+			}
+		})
+	}
+}
@@ -7,7 +7,6 @@ import (
 	"io"
 	"net/http"
 	"os"
-	"os/exec"
 	"path"
 	"path/filepath"
 	"strings"
@@ -20,23 +19,99 @@ import (
 	"golang.org/x/text/unicode/norm"
 )
 
+// Store identifies a single password-store mounted under Name.
+type Store struct {
+	Name string
+	Path string
+}
+
 type secretName struct {
+	Store    string `json:"store"`
 	Path     string `json:"path"`
 	Username string `json:"username"`
 }
 
 // SecretsResource implements
-// https://github.com/cpoppema/pass-server-node/blob/master/SPEC.rst when
-// pointed to a password-store directory.
+// https://github.com/cpoppema/pass-server-node/blob/master/SPEC.rst,
+// extended to serve secrets out of more than one password-store.
 type SecretsResource struct {
-	store string
+	stores []Store
 
 	// Below are the encrypted values used for the responses generated by
 	// the List and Show methods. These are populated by the Load method.
 	sync.RWMutex
 	loaded  bool
-	index   string
+	index   map[string]string
+	eventID int
 	secrets map[secretName]string
+
+	// subMu guards the Stream subscriber registry; kept separate from the
+	// RWMutex above so publishing never blocks a concurrent Load/Show/List.
+	subMu       sync.Mutex
+	subscribers map[chan indexEvent]struct{}
+
+	// storeLocks serializes Create/Update/Delete against a given store's
+	// working tree and git state, keyed by store name; lazily populated.
+	storeLocks sync.Map
+}
+
+// lockStore locks the per-store mutex for name, creating it on first use,
+// and returns a function that unlocks it.
+func (v *SecretsResource) lockStore(name string) func() {
+	mu, _ := v.storeLocks.LoadOrStore(name, &sync.Mutex{})
+	mu.(*sync.Mutex).Lock()
+	return mu.(*sync.Mutex).Unlock
+}
+
+// defaultStoreName is the store name used when STORES is unset and the
+// single-store PASSWORD_STORE shortcut applies instead.
+const defaultStoreName = "default"
+
+// parseStores parses the STORES env var into a list of stores. s is either a
+// JSON array of {"name":...,"path":...} objects, or a colon-separated list
+// of "name=path" entries, e.g. "work=/stores/work:personal=/stores/personal".
+func parseStores(s string) ([]Store, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return nil, nil
+	}
+	if strings.HasPrefix(s, "[") {
+		var raw []struct {
+			Name string `json:"name"`
+			Path string `json:"path"`
+		}
+		if err := json.Unmarshal([]byte(s), &raw); err != nil {
+			return nil, errors.Wrap(err, "unable to parse STORES as JSON")
+		}
+		stores := make([]Store, len(raw))
+		for i, entry := range raw {
+			stores[i] = Store{Name: entry.Name, Path: entry.Path}
+		}
+		return stores, nil
+	}
+	var stores []Store
+	for _, entry := range strings.Split(s, ":") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		parts := strings.SplitN(entry, "=", 2)
+		if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+			return nil, errors.Errorf("invalid STORES entry %q, expected name=path", entry)
+		}
+		stores = append(stores, Store{Name: parts[0], Path: parts[1]})
+	}
+	return stores, nil
+}
+
+// storeByName returns the configured store with the given name.
+func (v *SecretsResource) storeByName(name string) (Store, bool) {
+	for _, store := range v.stores {
+		if store.Name == name {
+			return store, true
+		}
+	}
+	return Store{}, false
 }
 
 // List implements POST /secrets/
@@ -53,9 +128,9 @@ func (v *SecretsResource) List(c buffalo.Context) error {
 		return v.error(c, http.StatusInternalServerError, errors.Wrap(err, "unable to load password store"))
 	}
 	var response struct {
-		Response string `json:"response"`
+		Response map[string]string `json:"response"`
 	}
-	response.Response = v.index
+	response.Response = filterIndexByScope(allowedPrefixes(c), v.index)
 	return c.Render(200, r.JSON(response))
 }
 
@@ -66,12 +141,21 @@ func (v *SecretsResource) Show(c buffalo.Context) error {
 	if err != nil {
 		return v.error(c, http.StatusBadRequest, errors.Wrap(err, "unable to read request body"))
 	}
+	if req.Store == "" {
+		return v.error(c, http.StatusBadRequest, errors.New("no store found in request body"))
+	}
 	if req.Path == "" {
 		return v.error(c, http.StatusBadRequest, errors.New("no path found in request body"))
 	}
 	if req.Username == "" {
 		return v.error(c, http.StatusBadRequest, errors.New("no username found in request body"))
 	}
+	if !authorized(allowedPrefixes(c), req.Store, req.Path) {
+		return v.error(c, http.StatusForbidden, errors.New("token not authorized for this path"))
+	}
+	if _, ok := v.storeByName(req.Store); !ok {
+		return v.error(c, http.StatusBadRequest, errors.New("unknown store"))
+	}
 	var response struct {
 		Response string `json:"response"`
 	}
@@ -88,89 +172,88 @@ func (v *SecretsResource) Show(c buffalo.Context) error {
 	return c.Render(http.StatusOK, r.JSON(response))
 }
 
-// Load updates the values in v.index and v.secrets while holding the write
-// lock.
+// Load rebuilds v.index and v.secrets from every configured store, updating
+// them while holding the write lock. The encrypted index is produced
+// separately for each store, since each store has its own .gpg-id
+// recipients.
 func (v *SecretsResource) Load() error {
-	filenames := make([]string, 0, 32)
-	walkFn := func(path string, info os.FileInfo, err error) error {
-		if err != nil {
-			return err
-		}
-		if info.IsDir() && info.Name() == ".git" {
-			return filepath.SkipDir
-		}
-		if info.IsDir() {
-			return nil
-		}
-		if filepath.Dir(path) == v.store {
-			return nil
-		}
-		if match, _ := filepath.Match("*.gpg", info.Name()); match {
-			filenames = append(filenames, path)
-		}
-		return nil
-	}
-	err := filepath.Walk(v.store, walkFn)
-	if err != nil {
-		return errors.Wrap(err, "issue while discovering secrets")
-	}
 	type item struct {
+		Store              string `json:"store"`
 		Domain             string `json:"domain"`
 		Path               string `json:"path"`
 		Username           string `json:"username"`
 		UsernameNormalized string `json:"username_normalized"`
 	}
-	index := make([]item, 0, 32)
+	index := make(map[string]string, len(v.stores))
 	secrets := make(map[secretName]string)
-	for _, filename := range filenames {
-		secret := strings.TrimSuffix(strings.TrimPrefix(filename, v.store), ".gpg")
-		username := path.Base(secret)
-		secret = strings.TrimPrefix(path.Dir(secret), "/")
-		domain := path.Base(secret)
-		index = append(index, item{
-			Domain:             domain,
-			Path:               secret,
-			Username:           username,
-			UsernameNormalized: normalize(username),
-		})
-		text, err := readSecret(filename)
+	for _, store := range v.stores {
+		filenames := make([]string, 0, 32)
+		walkFn := func(path string, info os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			if info.IsDir() && info.Name() == ".git" {
+				return filepath.SkipDir
+			}
+			if info.IsDir() {
+				return nil
+			}
+			if filepath.Dir(path) == store.Path {
+				return nil
+			}
+			if match, _ := filepath.Match("*.gpg", info.Name()); match {
+				filenames = append(filenames, path)
+			}
+			return nil
+		}
+		if err := filepath.Walk(store.Path, walkFn); err != nil {
+			return errors.Wrapf(err, "issue while discovering secrets in store %q", store.Name)
+		}
+		storeIndex := make([]item, 0, 32)
+		for _, filename := range filenames {
+			secret := strings.TrimSuffix(strings.TrimPrefix(filename, store.Path), ".gpg")
+			username := path.Base(secret)
+			secret = strings.TrimPrefix(path.Dir(secret), "/")
+			domain := path.Base(secret)
+			storeIndex = append(storeIndex, item{
+				Store:              store.Name,
+				Domain:             domain,
+				Path:               secret,
+				Username:           username,
+				UsernameNormalized: normalize(username),
+			})
+			text, err := readSecret(filename)
+			if err != nil {
+				return errors.Wrapf(err, "failed to read secret %s", filename)
+			}
+			secrets[secretName{
+				Store:    store.Name,
+				Path:     secret,
+				Username: username,
+			}] = string(text)
+		}
+		ids, err := readIDs(store.Path)
 		if err != nil {
-			return errors.Wrapf(err, "failed to read secret %s", filename)
+			return errors.Wrapf(err, "unable to load .gpg-id for store %q", store.Name)
 		}
-		secrets[secretName{
-			Path:     secret,
-			Username: username,
-		}] = string(text)
-	}
-	ids, err := readIDs(v.store)
-	if err != nil {
-		return errors.Wrap(err, "unable to load .gpg-id")
-	}
-	args := []string{"--encrypt", "--armor"}
-	for _, id := range ids {
-		args = append(args, "-r", id)
-	}
-	indexJSON, err := json.Marshal(index)
-	if err != nil {
-		return errors.Wrap(err, "failed to create index")
-	}
-	buf := &bytes.Buffer{}
-	cmd := exec.Command("gpg", args...)
-	cmd.Stdin = bytes.NewReader(indexJSON)
-	cmd.Stdout = buf
-	err = cmd.Run()
-	if err != nil {
-		return errors.Wrap(err, "unable to run gpg command to encrypt index")
-	}
-	err = cmd.Wait()
-	if err != nil {
-		return errors.Wrap(err, "unable to encrypt index")
+		indexJSON, err := json.Marshal(storeIndex)
+		if err != nil {
+			return errors.Wrapf(err, "failed to create index for store %q", store.Name)
+		}
+		armored, err := encryptIndex(store, ids, indexJSON)
+		if err != nil {
+			return errors.Wrapf(err, "unable to encrypt index for store %q", store.Name)
+		}
+		index[store.Name] = armored
 	}
 	v.Lock()
-	defer v.Unlock()
-	v.index = buf.String()
+	v.index = index
 	v.secrets = secrets
 	v.loaded = true
+	v.eventID++
+	eventID := v.eventID
+	v.Unlock()
+	v.publish(eventID, index)
 	return nil
 }
 
@@ -193,6 +276,27 @@ func (v *SecretsResource) error(c buffalo.Context, status int, err error) error
 	return c.Render(status, r.JSON(response))
 }
 
+// errorCode is like error, but additionally reports a machine-readable code
+// so that clients (e.g. browser extensions) can distinguish failure causes
+// without parsing the message.
+func (v *SecretsResource) errorCode(c buffalo.Context, status int, code errorCode, err error) error {
+	var response struct {
+		Error string    `json:"error"`
+		Code  errorCode `json:"code"`
+	}
+	response.Error = err.Error()
+	response.Code = code
+	return c.Render(status, r.JSON(response))
+}
+
+// invalidate marks the cached index and secrets as stale, forcing the next
+// List or Show call to reload from disk.
+func (v *SecretsResource) invalidate() {
+	v.Lock()
+	defer v.Unlock()
+	v.loaded = false
+}
+
 func readIDs(store string) ([]string, error) {
 	ids := make([]string, 0, 5)
 	f, err := os.Open(path.Join(store, ".gpg-id"))
@@ -0,0 +1,42 @@
+package actions
+
+import "testing"
+
+func TestParseStores(t *testing.T) {
+	t.Run("colon-separated list", func(t *testing.T) {
+		stores, err := parseStores("work=/stores/work:personal=/stores/personal")
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		want := []Store{{Name: "work", Path: "/stores/work"}, {Name: "personal", Path: "/stores/personal"}}
+		if len(stores) != len(want) {
+			t.Fatalf("got %v, want %v", stores, want)
+		}
+		for i := range want {
+			if stores[i] != want[i] {
+				t.Errorf("stores[%d] = %v, want %v", i, stores[i], want[i])
+			}
+		}
+	})
+	t.Run("JSON list", func(t *testing.T) {
+		stores, err := parseStores(`[{"name":"work","path":"/stores/work"}]`)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		want := []Store{{Name: "work", Path: "/stores/work"}}
+		if len(stores) != 1 || stores[0] != want[0] {
+			t.Fatalf("got %v, want %v", stores, want)
+		}
+	})
+	t.Run("empty is not configured", func(t *testing.T) {
+		stores, err := parseStores("")
+		if err != nil || stores != nil {
+			t.Fatalf("got %v, %v, want nil, nil", stores, err)
+		}
+	})
+	t.Run("malformed entry is rejected", func(t *testing.T) {
+		if _, err := parseStores("bogus"); err == nil {
+			t.Fatalf("expected error for entry missing '='")
+		}
+	})
+}
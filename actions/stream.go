@@ -0,0 +1,123 @@
+package actions
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/gobuffalo/buffalo"
+	"github.com/pkg/errors"
+)
+
+// indexEvent is one update pushed to Stream subscribers.
+type indexEvent struct {
+	id    int
+	index map[string]string
+}
+
+// Stream implements GET /secrets/stream. It upgrades the connection to
+// Server-Sent Events and pushes the current encrypted index right away,
+// followed by a fresh one every time the store is reloaded (whether by the
+// fsnotify watcher or a manual /reload), so long-lived browser extension
+// connections stay in sync without polling /secrets. Since every event
+// carries the full index, a client reconnecting with Last-Event-ID is
+// already caught up as soon as it receives the next event.
+func (v *SecretsResource) Stream(c buffalo.Context) error {
+	w := c.Response()
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		return v.error(c, http.StatusInternalServerError, errors.New("streaming not supported"))
+	}
+
+	scopes := allowedPrefixes(c)
+
+	v.RLock()
+	err := v.ensureLoaded()
+	if err != nil {
+		v.RUnlock()
+		return v.error(c, http.StatusInternalServerError, errors.Wrap(err, "unable to load password store"))
+	}
+	// Subscribe while still holding RLock, so a Load that completes the
+	// instant after we read index/eventID below is never missed: this
+	// subscriber is already registered before that snapshot is taken.
+	events, unsubscribe := v.subscribe()
+	index, eventID := v.index, v.eventID
+	v.RUnlock()
+	defer unsubscribe()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+	if err := writeIndexEvent(w, eventID, filterIndexByScope(scopes, index)); err != nil {
+		return err
+	}
+	flusher.Flush()
+
+	ctx := c.Request().Context()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case event := <-events:
+			if err := writeIndexEvent(w, event.id, filterIndexByScope(scopes, event.index)); err != nil {
+				return err
+			}
+			flusher.Flush()
+		}
+	}
+}
+
+func writeIndexEvent(w http.ResponseWriter, id int, index map[string]string) error {
+	var payload struct {
+		Response map[string]string `json:"response"`
+	}
+	payload.Response = index
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return errors.Wrap(err, "failed to marshal SSE payload")
+	}
+	_, err = fmt.Fprintf(w, "id: %d\ndata: %s\n\n", id, data)
+	return errors.Wrap(err, "failed to write SSE event")
+}
+
+// subscribe registers a new Stream subscriber and returns its event channel
+// along with an unsubscribe function. The channel is buffered to 1 and
+// drops a previously queued, not-yet-delivered event when a new one arrives,
+// so a slow subscriber only ever sees the most recent index.
+func (v *SecretsResource) subscribe() (chan indexEvent, func()) {
+	ch := make(chan indexEvent, 1)
+	v.subMu.Lock()
+	if v.subscribers == nil {
+		v.subscribers = make(map[chan indexEvent]struct{})
+	}
+	v.subscribers[ch] = struct{}{}
+	v.subMu.Unlock()
+	return ch, func() {
+		v.subMu.Lock()
+		delete(v.subscribers, ch)
+		v.subMu.Unlock()
+	}
+}
+
+// publish delivers event id/index to every subscriber, dropping the oldest
+// queued event for any subscriber that has not kept up.
+func (v *SecretsResource) publish(id int, index map[string]string) {
+	v.subMu.Lock()
+	defer v.subMu.Unlock()
+	event := indexEvent{id: id, index: index}
+	for ch := range v.subscribers {
+		select {
+		case ch <- event:
+		default:
+			select {
+			case <-ch:
+			default:
+			}
+			select {
+			case ch <- event:
+			default:
+			}
+		}
+	}
+}
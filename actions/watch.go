@@ -0,0 +1,115 @@
+package actions
+
+import (
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/gobuffalo/buffalo"
+	"github.com/pkg/errors"
+)
+
+// reloadDebounce coalesces bursts of filesystem events (e.g. a git pull
+// touching many files at once) into a single reload.
+const reloadDebounce = 200 * time.Millisecond
+
+// Watch performs an initial Load and then starts an fsnotify watcher that
+// triggers a reload whenever a *.gpg or .gpg-id file anywhere under any of
+// v.stores is created, written, renamed, or removed. It returns once the
+// initial Load and watcher setup have both succeeded; the watch loop itself
+// runs in a background goroutine for the lifetime of the process.
+func (v *SecretsResource) Watch() error {
+	if err := v.Load(); err != nil {
+		return errors.Wrap(err, "unable to perform initial load")
+	}
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return errors.Wrap(err, "unable to create filesystem watcher")
+	}
+	for _, store := range v.stores {
+		err = filepath.Walk(store.Path, func(path string, info os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			if !info.IsDir() {
+				return nil
+			}
+			if info.Name() == ".git" {
+				return filepath.SkipDir
+			}
+			return watcher.Add(path)
+		})
+		if err != nil {
+			watcher.Close()
+			return errors.Wrapf(err, "unable to watch store %q", store.Name)
+		}
+	}
+	go v.watchLoop(watcher)
+	return nil
+}
+
+// watchLoop consumes fsnotify events until watcher is closed, debouncing
+// relevant changes into calls to Load.
+func (v *SecretsResource) watchLoop(watcher *fsnotify.Watcher) {
+	defer watcher.Close()
+	var timer *time.Timer
+	reload := make(chan struct{}, 1)
+	for {
+		select {
+		case event, ok := <-watcher.Events:
+			if !ok {
+				return
+			}
+			if event.Op&fsnotify.Create != 0 {
+				if info, err := os.Stat(event.Name); err == nil && info.IsDir() && filepath.Base(event.Name) != ".git" {
+					if err := watcher.Add(event.Name); err != nil {
+						log.Printf("unable to watch %s: %v", event.Name, err)
+					}
+				}
+			}
+			if !relevantEvent(event) {
+				continue
+			}
+			if timer == nil {
+				timer = time.AfterFunc(reloadDebounce, func() {
+					select {
+					case reload <- struct{}{}:
+					default:
+					}
+				})
+			} else {
+				timer.Reset(reloadDebounce)
+			}
+		case <-reload:
+			if err := v.Load(); err != nil {
+				log.Printf("unable to reload password store: %v", err)
+			}
+		case err, ok := <-watcher.Errors:
+			if !ok {
+				return
+			}
+			log.Printf("filesystem watcher error: %v", err)
+		}
+	}
+}
+
+// relevantEvent reports whether event touches a file that can affect the
+// index or secrets built by Load.
+func relevantEvent(event fsnotify.Event) bool {
+	if filepath.Ext(event.Name) == ".gpg" {
+		return true
+	}
+	return filepath.Base(event.Name) == ".gpg-id"
+}
+
+// Reload implements POST /reload, a token-gated manual fallback for forcing
+// a reload of the password store outside of the filesystem watcher.
+func (v *SecretsResource) Reload(c buffalo.Context) error {
+	if err := v.Load(); err != nil {
+		return v.error(c, http.StatusInternalServerError, errors.Wrap(err, "unable to reload password store"))
+	}
+	return c.Render(http.StatusOK, r.JSON(struct{}{}))
+}
@@ -0,0 +1,194 @@
+package actions
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/gobuffalo/buffalo"
+	"github.com/pkg/errors"
+	"golang.org/x/crypto/openpgp/armor"
+)
+
+// errorCode identifies the cause of a write-side failure, similar to the
+// codes reported by browserpass-native, so clients can tell e.g. "path
+// already exists" from "git push failed" apart.
+type errorCode string
+
+const (
+	// ErrUnableToEncryptPasswordFile is returned when the submitted
+	// ciphertext could not be dearmored or written to the password file.
+	ErrUnableToEncryptPasswordFile errorCode = "unable_to_encrypt_password_file"
+	// ErrUnableToGitCommit is returned when the password file was written
+	// but committing the change to git failed. For Create, the just-written
+	// file is removed so the request is safe to retry; for Update/Delete
+	// the filesystem change already happened and is not rolled back.
+	ErrUnableToGitCommit errorCode = "unable_to_git_commit"
+	// ErrInvalidPasswordFileExtension is returned when path or username
+	// would not resolve to a sane *.gpg file inside the store.
+	ErrInvalidPasswordFileExtension errorCode = "invalid_password_file_extension"
+)
+
+type writeSecretRequest struct {
+	Store    string `json:"store"`
+	Path     string `json:"path"`
+	Username string `json:"username"`
+	Contents string `json:"contents"`
+}
+
+// Create implements POST /secret/new. It writes a new password file;
+// existing secrets are not overwritten.
+func (v *SecretsResource) Create(c buffalo.Context) error {
+	return v.write(c, false)
+}
+
+// Update implements POST /secret/edit. It overwrites an existing password
+// file's contents.
+func (v *SecretsResource) Update(c buffalo.Context) error {
+	return v.write(c, true)
+}
+
+func (v *SecretsResource) write(c buffalo.Context, overwrite bool) error {
+	var req writeSecretRequest
+	if err := c.Bind(&req); err != nil {
+		return v.error(c, http.StatusBadRequest, errors.Wrap(err, "unable to read request body"))
+	}
+	if req.Store == "" || req.Path == "" || req.Username == "" {
+		return v.error(c, http.StatusBadRequest, errors.New("no store, path, or username found in request body"))
+	}
+	if !authorized(allowedPrefixes(c), req.Store, req.Path) {
+		return v.error(c, http.StatusForbidden, errors.New("token not authorized for this path"))
+	}
+	store, ok := v.storeByName(req.Store)
+	if !ok {
+		return v.error(c, http.StatusBadRequest, errors.New("unknown store"))
+	}
+	unlock := v.lockStore(store.Name)
+	defer unlock()
+	filename, err := secretFilename(store.Path, req.Path, req.Username)
+	if err != nil {
+		return v.errorCode(c, http.StatusBadRequest, ErrInvalidPasswordFileExtension, err)
+	}
+	exists := fileExists(filename)
+	if overwrite && !exists {
+		return v.error(c, http.StatusBadRequest, errors.New("unknown secret"))
+	}
+	if !overwrite && exists {
+		return v.error(c, http.StatusBadRequest, errors.New("secret already exists"))
+	}
+	plaintext, err := dearmor(strings.NewReader(req.Contents))
+	if err != nil {
+		return v.errorCode(c, http.StatusBadRequest, ErrUnableToEncryptPasswordFile, errors.Wrap(err, "unable to dearmor secret"))
+	}
+	if err := os.MkdirAll(filepath.Dir(filename), 0700); err != nil {
+		return v.errorCode(c, http.StatusInternalServerError, ErrUnableToEncryptPasswordFile, errors.Wrap(err, "unable to create secret directory"))
+	}
+	if err := ioutil.WriteFile(filename, plaintext, 0600); err != nil {
+		return v.errorCode(c, http.StatusInternalServerError, ErrUnableToEncryptPasswordFile, errors.Wrap(err, "unable to write secret"))
+	}
+	verb := "add"
+	if overwrite {
+		verb = "edit"
+	}
+	relFilename := filepath.Join(req.Path, req.Username+".gpg")
+	if err := v.gitCommit(store.Path, relFilename, fmt.Sprintf("%s %s for %s", verb, req.Path, req.Username)); err != nil {
+		if !overwrite {
+			if rmErr := os.Remove(filename); rmErr != nil {
+				log.Printf("unable to clean up %s after failed git commit: %v", filename, rmErr)
+			}
+		}
+		v.invalidate()
+		return v.errorCode(c, http.StatusInternalServerError, ErrUnableToGitCommit, err)
+	}
+	v.invalidate()
+	return c.Render(http.StatusOK, r.JSON(struct{}{}))
+}
+
+// Delete implements POST /secret/delete.
+func (v *SecretsResource) Delete(c buffalo.Context) error {
+	var req secretName
+	if err := c.Bind(&req); err != nil {
+		return v.error(c, http.StatusBadRequest, errors.Wrap(err, "unable to read request body"))
+	}
+	if req.Store == "" || req.Path == "" || req.Username == "" {
+		return v.error(c, http.StatusBadRequest, errors.New("no store, path, or username found in request body"))
+	}
+	if !authorized(allowedPrefixes(c), req.Store, req.Path) {
+		return v.error(c, http.StatusForbidden, errors.New("token not authorized for this path"))
+	}
+	store, ok := v.storeByName(req.Store)
+	if !ok {
+		return v.error(c, http.StatusBadRequest, errors.New("unknown store"))
+	}
+	unlock := v.lockStore(store.Name)
+	defer unlock()
+	filename, err := secretFilename(store.Path, req.Path, req.Username)
+	if err != nil {
+		return v.errorCode(c, http.StatusBadRequest, ErrInvalidPasswordFileExtension, err)
+	}
+	if !fileExists(filename) {
+		return v.error(c, http.StatusBadRequest, errors.New("unknown secret"))
+	}
+	if err := os.Remove(filename); err != nil {
+		return v.errorCode(c, http.StatusInternalServerError, ErrUnableToEncryptPasswordFile, errors.Wrap(err, "unable to remove secret"))
+	}
+	relFilename := filepath.Join(req.Path, req.Username+".gpg")
+	if err := v.gitCommit(store.Path, relFilename, fmt.Sprintf("remove %s for %s", req.Path, req.Username)); err != nil {
+		v.invalidate()
+		return v.errorCode(c, http.StatusInternalServerError, ErrUnableToGitCommit, err)
+	}
+	v.invalidate()
+	return c.Render(http.StatusOK, r.JSON(struct{}{}))
+}
+
+// secretFilename resolves the on-disk *.gpg path for secretPath/username
+// inside store, rejecting anything that would escape the store.
+func secretFilename(store, secretPath, username string) (string, error) {
+	if strings.Contains(secretPath, "..") || strings.Contains(username, "..") {
+		return "", errors.New("path must not contain '..'")
+	}
+	if strings.ContainsAny(username, "/\\") {
+		return "", errors.New("username must not contain path separators")
+	}
+	return filepath.Join(store, secretPath, username+".gpg"), nil
+}
+
+func fileExists(filename string) bool {
+	_, err := os.Stat(filename)
+	return err == nil
+}
+
+// dearmor decodes an armored PGP message as submitted by the client into its
+// raw ciphertext, ready to be written to a *.gpg password file.
+func dearmor(rd io.Reader) ([]byte, error) {
+	block, err := armor.Decode(rd)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to decode armor")
+	}
+	return ioutil.ReadAll(block.Body)
+}
+
+// gitCommit stages relFilename (a path relative to storePath) and commits it
+// with message, when that store is a git repository. It is a no-op when it
+// is not. Only relFilename is staged, so unrelated dirty files already
+// sitting in the store are left out of the commit.
+func (v *SecretsResource) gitCommit(storePath, relFilename, message string) error {
+	if !fileExists(filepath.Join(storePath, ".git")) {
+		return nil
+	}
+	add := exec.Command("git", "-C", storePath, "add", "--", relFilename)
+	if out, err := add.CombinedOutput(); err != nil {
+		return errors.Wrapf(err, "unable to stage changes: %s", out)
+	}
+	commit := exec.Command("git", "-C", storePath, "commit", "-m", message)
+	if out, err := commit.CombinedOutput(); err != nil {
+		return errors.Wrapf(err, "unable to commit changes: %s", out)
+	}
+	return nil
+}
@@ -0,0 +1,39 @@
+package actions
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestSecretFilename(t *testing.T) {
+	tests := []struct {
+		name       string
+		secretPath string
+		username   string
+		want       string
+		wantErr    bool
+	}{
+		{"simple", "work", "jdoe", filepath.Join("/store", "work", "jdoe.gpg"), false},
+		{"dotted username is allowed", "personal", "jane.doe@example.com", filepath.Join("/store", "personal", "jane.doe@example.com.gpg"), false},
+		{"path traversal in path is rejected", "../etc", "jdoe", "", true},
+		{"path traversal in username is rejected", "work", "../jdoe", "", true},
+		{"path separator in username is rejected", "work", "jdoe/evil", "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := secretFilename("/store", tt.secretPath, tt.username)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("secretFilename(%q, %q) = %q, want error", tt.secretPath, tt.username, got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("secretFilename(%q, %q) returned unexpected error: %v", tt.secretPath, tt.username, err)
+			}
+			if got != tt.want {
+				t.Errorf("secretFilename(%q, %q) = %q, want %q", tt.secretPath, tt.username, got, tt.want)
+			}
+		})
+	}
+}